@@ -0,0 +1,161 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package accounts implements ergo's NickServ-style account lifecycle:
+// REGISTER, VERIFY, and IDENTIFY. An account starts Pending once
+// registered (unless its callback is "none"), and only becomes Verified
+// once its callback confirms it — a mailto link, or an oper running
+// `/msg NickServ VERIFY <account> <code>` for the "admin" callback.
+package accounts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/mengzhuo/ergo/irc/passwd"
+)
+
+// Status is where an account sits in the registration lifecycle.
+type Status int
+
+const (
+	StatusUnregistered Status = iota
+	StatusPending
+	StatusVerified
+)
+
+// Account is the durable record ergo keeps for a registered nick.
+type Account struct {
+	Name             string // casefolded
+	PassphraseHash   string // bcrypt, via irc/passwd
+	Status           Status
+	Callback         string // "mailto", "admin", or "none"
+	VerificationCode string
+	Certfp           string // TLS client cert fingerprint, for SASL EXTERNAL
+}
+
+// Store persists Accounts. The server's implementation lives over the
+// configured Datastore.Path; tests can supply an in-memory Store instead.
+type Store interface {
+	Get(name string) (Account, bool)
+	Put(account Account) error
+
+	// FindByCertfp looks up the account with the given TLS cert
+	// fingerprint on file, independent of its name. Used by SASL
+	// EXTERNAL, which authenticates whoever owns the cert rather than
+	// whoever the connection currently claims to be.
+	FindByCertfp(certfp string) (Account, bool)
+}
+
+var (
+	ErrAlreadyRegistered = errors.New("accounts: nick is already registered")
+	ErrNotRegistered     = errors.New("accounts: account isn't registered")
+	ErrAlreadyVerified   = errors.New("accounts: account is already verified")
+	ErrBadCode           = errors.New("accounts: verification code doesn't match")
+	ErrBadPassphrase     = errors.New("accounts: passphrase is incorrect")
+)
+
+// Register creates a new account for name with the given cleartext
+// passphrase. Accounts with callback "none" are verified immediately;
+// any other callback leaves the account Pending with a verification code.
+func Register(store Store, name string, passphrase []byte, callback string) (Account, error) {
+	if _, exists := store.Get(name); exists {
+		return Account{}, ErrAlreadyRegistered
+	}
+
+	hash, err := passwd.GenerateFromPassword(passphrase)
+	if err != nil {
+		return Account{}, err
+	}
+
+	account := Account{
+		Name:           name,
+		PassphraseHash: hash,
+		Callback:       callback,
+		Status:         StatusPending,
+	}
+
+	if callback == "none" {
+		account.Status = StatusVerified
+	} else {
+		code, err := generateCode()
+		if err != nil {
+			return Account{}, err
+		}
+		account.VerificationCode = code
+	}
+
+	if err := store.Put(account); err != nil {
+		return Account{}, err
+	}
+	return account, nil
+}
+
+// Verify marks a Pending account Verified if code matches. This is the
+// same call whether it's triggered by a mailto confirmation link or by
+// an oper running VERIFY for the "admin" callback.
+func Verify(store Store, name, code string) error {
+	account, exists := store.Get(name)
+	if !exists {
+		return ErrNotRegistered
+	}
+	if account.Status == StatusVerified {
+		return ErrAlreadyVerified
+	}
+	if account.VerificationCode != code {
+		return ErrBadCode
+	}
+
+	account.Status = StatusVerified
+	account.VerificationCode = ""
+	return store.Put(account)
+}
+
+// Identify checks passphrase against a verified account's stored hash,
+// for SASL PLAIN and NickServ IDENTIFY.
+func Identify(store Store, name string, passphrase []byte) (Account, error) {
+	account, exists := store.Get(name)
+	if !exists || account.Status != StatusVerified {
+		return Account{}, ErrNotRegistered
+	}
+	if !passwd.CompareHashAndPassword(account.PassphraseHash, passphrase) {
+		return Account{}, ErrBadPassphrase
+	}
+	return account, nil
+}
+
+// IdentifyByCertfp finds the account, if any, registered with this TLS
+// cert fingerprint, for SASL EXTERNAL. Unlike Identify, this doesn't take
+// an account name: EXTERNAL authenticates whoever owns the presented
+// cert, independent of the nick the client happens to be connected as.
+func IdentifyByCertfp(store Store, certfp string) (Account, error) {
+	if certfp == "" {
+		return Account{}, ErrNotRegistered
+	}
+	account, exists := store.FindByCertfp(certfp)
+	if !exists || account.Status != StatusVerified {
+		return Account{}, ErrNotRegistered
+	}
+	return account, nil
+}
+
+// SetCertfp records certfp against an existing account, pending or
+// verified, so a later SASL EXTERNAL from the same cert can identify
+// without a password once the account is verified.
+func SetCertfp(store Store, name, certfp string) error {
+	account, exists := store.Get(name)
+	if !exists {
+		return ErrNotRegistered
+	}
+	account.Certfp = certfp
+	return store.Put(account)
+}
+
+func generateCode() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package accounts
+
+import "testing"
+
+type memStore struct {
+	accounts map[string]Account
+}
+
+func newMemStore() *memStore {
+	return &memStore{accounts: make(map[string]Account)}
+}
+
+func (s *memStore) Get(name string) (Account, bool) {
+	account, ok := s.accounts[name]
+	return account, ok
+}
+
+func (s *memStore) Put(account Account) error {
+	s.accounts[account.Name] = account
+	return nil
+}
+
+func (s *memStore) FindByCertfp(certfp string) (Account, bool) {
+	for _, account := range s.accounts {
+		if account.Certfp == certfp {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+func TestRegisterWithNoneCallbackIsImmediatelyVerified(t *testing.T) {
+	store := newMemStore()
+	account, err := Register(store, "shivaram", []byte("hunter2"), "none")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if account.Status != StatusVerified {
+		t.Fatalf("expected callback \"none\" to verify immediately, got status %v", account.Status)
+	}
+
+	if _, err := Identify(store, "shivaram", []byte("hunter2")); err != nil {
+		t.Fatalf("expected to identify immediately, got %s", err.Error())
+	}
+}
+
+func TestRegisterWithAdminCallbackRequiresVerify(t *testing.T) {
+	store := newMemStore()
+	account, err := Register(store, "shivaram", []byte("hunter2"), "admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if account.Status != StatusPending {
+		t.Fatalf("expected pending status, got %v", account.Status)
+	}
+
+	if _, err := Identify(store, "shivaram", []byte("hunter2")); err != ErrNotRegistered {
+		t.Fatalf("expected identify to fail before verification, got %v", err)
+	}
+
+	if err := Verify(store, "shivaram", "wrong code"); err != ErrBadCode {
+		t.Fatalf("expected ErrBadCode, got %v", err)
+	}
+
+	if err := Verify(store, "shivaram", account.VerificationCode); err != nil {
+		t.Fatalf("expected verify to succeed, got %s", err.Error())
+	}
+
+	if _, err := Identify(store, "shivaram", []byte("hunter2")); err != nil {
+		t.Fatalf("expected to identify after verification, got %s", err.Error())
+	}
+}
+
+func TestRegisterRejectsDuplicateName(t *testing.T) {
+	store := newMemStore()
+	if _, err := Register(store, "shivaram", []byte("hunter2"), "none"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := Register(store, "shivaram", []byte("different"), "none"); err != ErrAlreadyRegistered {
+		t.Fatalf("expected ErrAlreadyRegistered, got %v", err)
+	}
+}
+
+func TestIdentifyByCertfp(t *testing.T) {
+	store := newMemStore()
+	if _, err := Register(store, "shivaram", []byte("hunter2"), "none"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := SetCertfp(store, "shivaram", "deadbeef"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	account, err := IdentifyByCertfp(store, "deadbeef")
+	if err != nil {
+		t.Fatalf("expected matching certfp to identify, got %s", err.Error())
+	}
+	if account.Name != "shivaram" {
+		t.Fatalf("expected to identify shivaram, got %q", account.Name)
+	}
+	if _, err := IdentifyByCertfp(store, "wrongfp"); err != ErrNotRegistered {
+		t.Fatalf("expected ErrNotRegistered for unknown certfp, got %v", err)
+	}
+}
+
+func TestIdentifyByCertfpIgnoresConnectionNick(t *testing.T) {
+	store := newMemStore()
+	if _, err := Register(store, "shivaram", []byte("hunter2"), "none"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := SetCertfp(store, "shivaram", "deadbeef"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	// a client reconnecting under a different nick should still
+	// identify by certfp alone
+	account, err := IdentifyByCertfp(store, "deadbeef")
+	if err != nil {
+		t.Fatalf("expected matching certfp to identify regardless of nick, got %s", err.Error())
+	}
+	if account.Name != "shivaram" {
+		t.Fatalf("expected to identify shivaram, got %q", account.Name)
+	}
+}
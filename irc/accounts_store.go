@@ -0,0 +1,85 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/mengzhuo/ergo/irc/accounts"
+)
+
+// fileAccountStore persists registered accounts as a single JSON document
+// under Datastore.Path, keyed by casefolded name.
+type fileAccountStore struct {
+	sync.Mutex
+	path string
+}
+
+func newFileAccountStore(datastorePath string) *fileAccountStore {
+	return &fileAccountStore{path: datastorePath + "/accounts.json"}
+}
+
+func (store *fileAccountStore) all() (map[string]accounts.Account, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return map[string]accounts.Account{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]accounts.Account)
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (store *fileAccountStore) Get(name string) (accounts.Account, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	all, err := store.all()
+	if err != nil {
+		return accounts.Account{}, false
+	}
+	account, exists := all[name]
+	return account, exists
+}
+
+func (store *fileAccountStore) FindByCertfp(certfp string) (accounts.Account, bool) {
+	store.Lock()
+	defer store.Unlock()
+
+	all, err := store.all()
+	if err != nil {
+		return accounts.Account{}, false
+	}
+	for _, account := range all {
+		if account.Certfp == certfp {
+			return account, true
+		}
+	}
+	return accounts.Account{}, false
+}
+
+func (store *fileAccountStore) Put(account accounts.Account) error {
+	store.Lock()
+	defer store.Unlock()
+
+	all, err := store.all()
+	if err != nil {
+		return err
+	}
+	all[account.Name] = account
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(store.path, data, 0600)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package cloaks computes stable, HMAC-based hostname cloaks for client
+// IP addresses, so WHOIS/JOIN can show something other than a raw PTR
+// record (or the IP itself) for users without a manual vhost.
+package cloaks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"net"
+	"strings"
+)
+
+// Config controls how cloaks are computed.
+type Config struct {
+	Enabled     bool
+	Netname     string
+	CidrLenIPv4 int
+	CidrLenIPv6 int
+	NumBits     int
+	Secret      string
+}
+
+// lowercaseEncoding is standard base32 without padding. Its output is
+// uppercase; ComputeCloak lowercases it so the cloak reads like an
+// ordinary hostname.
+var lowercaseEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ComputeCloak returns the cloaked hostname for ip, of the form
+// "<label>.<label>....<netname>". It's deterministic for a given secret
+// and CIDR, so a client's cloak is stable across reconnects, but it
+// doesn't reveal the original IP: every address in the same truncated
+// CIDR hashes to the same cloak.
+func ComputeCloak(ip net.IP, config Config) string {
+	mac := hmac.New(sha256.New, []byte(config.Secret))
+	mac.Write(truncatedCIDR(ip, config))
+	sum := mac.Sum(nil)
+
+	encoded := strings.ToLower(lowercaseEncoding.EncodeToString(sum))
+
+	labelLen := config.NumBits / 5 // base32 packs 5 bits per character
+	if labelLen < 1 {
+		labelLen = 1
+	}
+
+	var labels []string
+	for len(encoded) > 0 {
+		n := labelLen
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		labels = append(labels, encoded[:n])
+		encoded = encoded[n:]
+	}
+
+	return strings.Join(labels, ".") + "." + config.Netname
+}
+
+// truncatedCIDR masks ip down to the configured prefix length, using the
+// IPv4 or IPv6 length depending on which family ip belongs to.
+func truncatedCIDR(ip net.IP, config Config) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(config.CidrLenIPv4, 32))
+	}
+	return ip.Mask(net.CIDRMask(config.CidrLenIPv6, 128))
+}
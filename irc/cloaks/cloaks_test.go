@@ -0,0 +1,53 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package cloaks
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func testConfig() Config {
+	return Config{
+		Enabled:     true,
+		Netname:     "irc.example.com",
+		CidrLenIPv4: 24,
+		CidrLenIPv6: 64,
+		NumBits:     20,
+		Secret:      "test secret, do not use in production",
+	}
+}
+
+func TestCloakIsStableAcrossReconnects(t *testing.T) {
+	config := testConfig()
+	ip := net.ParseIP("192.168.1.42")
+
+	first := ComputeCloak(ip, config)
+	second := ComputeCloak(ip, config)
+	if first != second {
+		t.Fatalf("expected stable cloak, got %q then %q", first, second)
+	}
+	if !strings.HasSuffix(first, "."+config.Netname) {
+		t.Fatalf("expected cloak to end in netname, got %q", first)
+	}
+}
+
+func TestCloakSharedWithinCIDR(t *testing.T) {
+	config := testConfig()
+	a := ComputeCloak(net.ParseIP("192.168.1.1"), config)
+	b := ComputeCloak(net.ParseIP("192.168.1.254"), config)
+	if a != b {
+		t.Fatalf("expected addresses in the same /24 to share a cloak, got %q and %q", a, b)
+	}
+}
+
+func TestCloakDiffersAcrossCIDRs(t *testing.T) {
+	config := testConfig()
+	a := ComputeCloak(net.ParseIP("192.168.1.1"), config)
+	b := ComputeCloak(net.ParseIP("192.168.2.1"), config)
+	if a == b {
+		t.Fatal("expected addresses in different /24s to get different cloaks")
+	}
+}
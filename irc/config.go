@@ -9,11 +9,15 @@ import (
 	"crypto/tls"
 	"errors"
 	"io/ioutil"
-	"log"
 
 	"gopkg.in/yaml.v2"
+
+	"github.com/mengzhuo/ergo/irc/logger"
+	"github.com/mengzhuo/ergo/irc/passwd"
 )
 
+// PassConfig holds a password as stored in the YAML config: a bcrypt hash,
+// not the cleartext. Use `ergo genpasswd` to produce the hash to paste in.
 type PassConfig struct {
 	Password string
 }
@@ -36,12 +40,16 @@ func (conf *TLSListenConfig) Config() (*tls.Config, error) {
 	}, err
 }
 
+// PasswordBytes returns the raw bcrypt hash, for callers (like the opers
+// map) that just need something comparable to key off of.
 func (conf *PassConfig) PasswordBytes() []byte {
-	bytes, err := DecodePassword(conf.Password)
-	if err != nil {
-		log.Fatal("decode password error: ", err)
-	}
-	return bytes
+	return []byte(conf.Password)
+}
+
+// CheckPassphrase reports whether cleartext matches the bcrypt hash stored
+// in this config, e.g. for /OPER or the server PASS command.
+func (conf *PassConfig) CheckPassphrase(cleartext []byte) bool {
+	return passwd.CompareHashAndPassword(conf.Password, cleartext)
 }
 
 type AccountRegistrationConfig struct {
@@ -62,7 +70,62 @@ type AccountRegistrationConfig struct {
 			VerifyMessageSubject string `yaml:"verify-message-subject"`
 			VerifyMessage        string `yaml:"verify-message"`
 		}
+
+		// Admin is for networks with no mail transport configured: a
+		// newly registered account sits Pending until an oper runs
+		// `/msg NickServ VERIFY <account> <code>`.
+		Admin struct {
+			Enabled bool
+		}
 	}
+
+	// RequireSASL refuses registration (PASS/NICK/USER) from clients that
+	// didn't complete SASL, for private/whitelisted networks.
+	RequireSASL bool `yaml:"require-sasl"`
+}
+
+// ConnectionLimitsConfig controls how many simultaneous connections we
+// accept from a single CIDR block.
+type ConnectionLimitsConfig struct {
+	Enabled            bool
+	CidrLenIPv4        int      `yaml:"cidr-len-ipv4"`
+	CidrLenIPv6        int      `yaml:"cidr-len-ipv6"`
+	ConnectionsPerCidr int      `yaml:"connections-per-cidr"`
+	ExemptedCIDRs      []string `yaml:"exempted-cidrs"`
+}
+
+// ConnectionThrottleConfig controls how fast a single CIDR block can open
+// new connections before it's temporarily banned.
+type ConnectionThrottleConfig struct {
+	Enabled        bool
+	CidrLenIPv4    int `yaml:"cidr-len-ipv4"`
+	CidrLenIPv6    int `yaml:"cidr-len-ipv6"`
+	Duration       string
+	MaxConnections int      `yaml:"max-connections"`
+	BanDuration    string   `yaml:"ban-duration"`
+	BanMessage     string   `yaml:"ban-message"`
+	ExemptedCIDRs  []string `yaml:"exempted-cidrs"`
+}
+
+// IPCloakingConfig controls how raw client hostnames/IPs are cloaked.
+type IPCloakingConfig struct {
+	Enabled     bool
+	Netname     string
+	CidrLenIPv4 int `yaml:"cidr-len-ipv4"`
+	CidrLenIPv6 int `yaml:"cidr-len-ipv6"`
+	NumBits     int `yaml:"num-bits"`
+	Secret      string
+}
+
+// LoggingConfig is one entry of the top-level `Logging` config array: a
+// single destination (stderr, a file, or both) along with the subsystems
+// and level it should receive.
+type LoggingConfig struct {
+	Method       string
+	Filename     string
+	Level        string
+	Types        []string
+	ExcludeTypes []string `yaml:"exclude-types"`
 }
 
 type Config struct {
@@ -70,6 +133,8 @@ type Config struct {
 		Name string
 	}
 
+	Logging []LoggingConfig
+
 	Server struct {
 		PassConfig
 		Password         string
@@ -81,6 +146,10 @@ type Config struct {
 		Log              string
 		MOTD             string
 		ProxyAllowedFrom []string `yaml:"proxy-allowed-from"`
+
+		ConnectionLimits   ConnectionLimitsConfig   `yaml:"connection-limits"`
+		ConnectionThrottle ConnectionThrottleConfig `yaml:"connection-throttle"`
+		IPCloaking         IPCloakingConfig         `yaml:"ip-cloaking"`
 	}
 
 	Datastore struct {
@@ -110,27 +179,31 @@ func (conf *Config) Operators() map[string][]byte {
 		if err == nil {
 			operators[name] = opConf.PasswordBytes()
 		} else {
-			log.Println("Could not casefold oper name:", err.Error())
+			logger.Log(logger.LevelWarn, "server", "Could not casefold oper name:", err.Error())
 		}
 	}
 	return operators
 }
 
-func (conf *Config) TLSListeners() map[string]*tls.Config {
+// TLSListeners returns the parsed *tls.Config for every configured TLS
+// listener. It returns an error, rather than killing the process, if any
+// listener's cert+key pair fails to load, so a bad rehash or a typo'd
+// path can't bring the server down mid-load.
+func (conf *Config) TLSListeners() (map[string]*tls.Config, error) {
 	tlsListeners := make(map[string]*tls.Config)
 	for s, tlsListenersConf := range conf.Server.TLSListeners {
 		config, err := tlsListenersConf.Config()
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		name, err := CasefoldName(s)
 		if err == nil {
 			tlsListeners[name] = config
 		} else {
-			log.Println("Could not casefold TLS listener:", err.Error())
+			logger.Log(logger.LevelWarn, "server", "Could not casefold TLS listener:", err.Error())
 		}
 	}
-	return tlsListeners
+	return tlsListeners, nil
 }
 
 func LoadConfig(filename string) (config *Config, err error) {
@@ -0,0 +1,120 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package connection_limits caps the number of simultaneous connections
+// and the rate of new connections ergo will accept from a single CIDR
+// block, so one host (or one botted /64) can't eat every client slot.
+package connection_limits
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// LimiterConfig mirrors irc.ConnectionLimitsConfig; it's duplicated here
+// (rather than imported) so this package doesn't depend on irc.
+type LimiterConfig struct {
+	Enabled            bool
+	CidrLenIPv4        int
+	CidrLenIPv6        int
+	ConnectionsPerCidr int
+	ExemptedCIDRs      []string
+}
+
+// Limiter tracks how many live connections each CIDR block currently
+// holds and rejects new ones past the configured ceiling.
+type Limiter struct {
+	sync.Mutex
+
+	enabled      bool
+	cidrLenIPv4  int
+	cidrLenIPv6  int
+	maxPerCidr   int
+	exemptedNets []*net.IPNet
+	countPerCidr map[string]int
+}
+
+// NewLimiter builds a Limiter from config, pre-parsing the exempted CIDRs.
+func NewLimiter(config LimiterConfig) (*Limiter, error) {
+	limiter := &Limiter{
+		enabled:      config.Enabled,
+		cidrLenIPv4:  config.CidrLenIPv4,
+		cidrLenIPv6:  config.CidrLenIPv6,
+		maxPerCidr:   config.ConnectionsPerCidr,
+		countPerCidr: make(map[string]int),
+	}
+
+	for _, cidr := range config.ExemptedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exempted CIDR %q: %s", cidr, err.Error())
+		}
+		limiter.exemptedNets = append(limiter.exemptedNets, ipNet)
+	}
+
+	return limiter, nil
+}
+
+// AddClient registers a new connection from ip, returning an error (and
+// not registering it) if ip's CIDR bucket is already full.
+func (limiter *Limiter) AddClient(ip net.IP) error {
+	if !limiter.enabled || limiter.isExempted(ip) {
+		return nil
+	}
+
+	key := cidrKey(ip, limiter.cidrLenIPv4, limiter.cidrLenIPv6)
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.countPerCidr[key] >= limiter.maxPerCidr {
+		return ErrLimitExceeded
+	}
+	limiter.countPerCidr[key]++
+	return nil
+}
+
+// RemoveClient releases the slot ip's connection was holding. It's a
+// no-op if the limiter is disabled or ip was exempted, mirroring AddClient.
+func (limiter *Limiter) RemoveClient(ip net.IP) {
+	if !limiter.enabled || limiter.isExempted(ip) {
+		return
+	}
+
+	key := cidrKey(ip, limiter.cidrLenIPv4, limiter.cidrLenIPv6)
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.countPerCidr[key] > 0 {
+		limiter.countPerCidr[key]--
+		if limiter.countPerCidr[key] == 0 {
+			delete(limiter.countPerCidr, key)
+		}
+	}
+}
+
+func (limiter *Limiter) isExempted(ip net.IP) bool {
+	for _, ipNet := range limiter.exemptedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// cidrKey truncates ip to the given prefix length (v4Bits for IPv4,
+// v6Bits for IPv6) and returns it as a string suitable for map keying.
+func cidrKey(ip net.IP, v4Bits, v6Bits int) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(v4Bits, 32)
+		return ip4.Mask(mask).String()
+	}
+	mask := net.CIDRMask(v6Bits, 128)
+	return ip.Mask(mask).String()
+}
+
+// ErrLimitExceeded is returned by AddClient when a CIDR's connection
+// bucket is already full.
+var ErrLimitExceeded = fmt.Errorf("connection limit exceeded for this CIDR")
@@ -0,0 +1,119 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package connection_limits
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimiterRejectsOverCapacity(t *testing.T) {
+	limiter, err := NewLimiter(LimiterConfig{
+		Enabled:            true,
+		CidrLenIPv4:        32,
+		CidrLenIPv6:        64,
+		ConnectionsPerCidr: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building limiter: %s", err.Error())
+	}
+
+	ip := net.ParseIP("1.2.3.4")
+
+	if err := limiter.AddClient(ip); err != nil {
+		t.Fatalf("first connection should be allowed, got %s", err.Error())
+	}
+	if err := limiter.AddClient(ip); err != nil {
+		t.Fatalf("second connection should be allowed, got %s", err.Error())
+	}
+	if err := limiter.AddClient(ip); err != ErrLimitExceeded {
+		t.Fatalf("third connection should be rejected, got %v", err)
+	}
+
+	limiter.RemoveClient(ip)
+	if err := limiter.AddClient(ip); err != nil {
+		t.Fatalf("connection after a slot frees up should be allowed, got %s", err.Error())
+	}
+}
+
+func TestLimiterExemptsConfiguredCIDRs(t *testing.T) {
+	limiter, err := NewLimiter(LimiterConfig{
+		Enabled:            true,
+		CidrLenIPv4:        32,
+		ConnectionsPerCidr: 1,
+		ExemptedCIDRs:      []string{"127.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building limiter: %s", err.Error())
+	}
+
+	ip := net.ParseIP("127.0.0.1")
+	for i := 0; i < 5; i++ {
+		if err := limiter.AddClient(ip); err != nil {
+			t.Fatalf("exempted CIDR should never be rejected, got %s", err.Error())
+		}
+	}
+}
+
+func TestThrottlerBansRapidReconnectFloods(t *testing.T) {
+	throttler, err := NewThrottler(ThrottlerConfig{
+		Enabled:        true,
+		CidrLenIPv4:    32,
+		Duration:       time.Minute,
+		MaxConnections: 3,
+		BanDuration:    time.Hour,
+		BanMessage:     "reconnecting too fast, try again later",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building throttler: %s", err.Error())
+	}
+
+	ip := net.ParseIP("5.6.7.8")
+	start := time.Unix(0, 0)
+
+	for i := 0; i < 3; i++ {
+		if err := throttler.AddClient(ip, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("connection %d should be allowed, got %s", i, err.Error())
+		}
+	}
+
+	// the 4th reconnect within the window should trip the ban
+	if err := throttler.AddClient(ip, start.Add(3*time.Second)); err == nil {
+		t.Fatal("expected flood to be banned")
+	}
+
+	// and the ban should hold even after the original window has passed
+	if err := throttler.AddClient(ip, start.Add(2*time.Minute)); err == nil {
+		t.Fatal("expected CIDR to still be banned")
+	}
+
+	// but should lift once the ban duration elapses
+	if err := throttler.AddClient(ip, start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("expected ban to have lifted, got %s", err.Error())
+	}
+}
+
+func TestThrottlerExemptsConfiguredCIDRs(t *testing.T) {
+	throttler, err := NewThrottler(ThrottlerConfig{
+		Enabled:        true,
+		CidrLenIPv4:    32,
+		Duration:       time.Minute,
+		MaxConnections: 1,
+		BanDuration:    time.Hour,
+		BanMessage:     "reconnecting too fast, try again later",
+		ExemptedCIDRs:  []string{"127.0.0.0/8"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building throttler: %s", err.Error())
+	}
+
+	ip := net.ParseIP("127.0.0.1")
+	start := time.Unix(0, 0)
+	for i := 0; i < 5; i++ {
+		if err := throttler.AddClient(ip, start.Add(time.Duration(i)*time.Second)); err != nil {
+			t.Fatalf("exempted CIDR should never be throttled, got %s", err.Error())
+		}
+	}
+}
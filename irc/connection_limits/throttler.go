@@ -0,0 +1,123 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package connection_limits
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ThrottlerConfig mirrors irc.ConnectionThrottleConfig.
+type ThrottlerConfig struct {
+	Enabled        bool
+	CidrLenIPv4    int
+	CidrLenIPv6    int
+	Duration       time.Duration
+	MaxConnections int
+	BanDuration    time.Duration
+	BanMessage     string
+	ExemptedCIDRs  []string
+}
+
+// Throttler tracks connection attempts in a sliding window per CIDR and
+// temporarily bans CIDRs that reconnect too fast.
+type Throttler struct {
+	sync.Mutex
+
+	enabled        bool
+	cidrLenIPv4    int
+	cidrLenIPv6    int
+	window         time.Duration
+	maxConnections int
+	banDuration    time.Duration
+	banMessage     string
+	exemptedNets   []*net.IPNet
+
+	attempts    map[string][]time.Time
+	bannedUntil map[string]time.Time
+}
+
+// NewThrottler builds a Throttler from config, pre-parsing the exempted
+// CIDRs the same way NewLimiter does.
+func NewThrottler(config ThrottlerConfig) (*Throttler, error) {
+	throttler := &Throttler{
+		enabled:        config.Enabled,
+		cidrLenIPv4:    config.CidrLenIPv4,
+		cidrLenIPv6:    config.CidrLenIPv6,
+		window:         config.Duration,
+		maxConnections: config.MaxConnections,
+		banDuration:    config.BanDuration,
+		banMessage:     config.BanMessage,
+		attempts:       make(map[string][]time.Time),
+		bannedUntil:    make(map[string]time.Time),
+	}
+
+	for _, cidr := range config.ExemptedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exempted CIDR %q: %s", cidr, err.Error())
+		}
+		throttler.exemptedNets = append(throttler.exemptedNets, ipNet)
+	}
+
+	return throttler, nil
+}
+
+// AddClientNow is AddClient using the current time; this is what the
+// accept loop calls in production. AddClient takes an explicit time so
+// tests can simulate a flood without sleeping.
+func (throttler *Throttler) AddClientNow(ip net.IP) error {
+	return throttler.AddClient(ip, time.Now())
+}
+
+// AddClient records a new connection attempt from ip at time now, banning
+// ip's CIDR if this pushes it over the allowed rate. It returns an error
+// (with the ban message) if the CIDR is already banned or just got banned.
+func (throttler *Throttler) AddClient(ip net.IP, now time.Time) error {
+	if !throttler.enabled || throttler.isExempted(ip) {
+		return nil
+	}
+
+	key := cidrKey(ip, throttler.cidrLenIPv4, throttler.cidrLenIPv6)
+
+	throttler.Lock()
+	defer throttler.Unlock()
+
+	if until, banned := throttler.bannedUntil[key]; banned {
+		if now.Before(until) {
+			return fmt.Errorf("%s", throttler.banMessage)
+		}
+		delete(throttler.bannedUntil, key)
+		delete(throttler.attempts, key)
+	}
+
+	cutoff := now.Add(-throttler.window)
+	var recent []time.Time
+	for _, t := range throttler.attempts[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	throttler.attempts[key] = recent
+
+	if len(recent) > throttler.maxConnections {
+		throttler.bannedUntil[key] = now.Add(throttler.banDuration)
+		delete(throttler.attempts, key)
+		return fmt.Errorf("%s", throttler.banMessage)
+	}
+
+	return nil
+}
+
+func (throttler *Throttler) isExempted(ip net.IP) bool {
+	for _, ipNet := range throttler.exemptedNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
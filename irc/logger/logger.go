@@ -0,0 +1,191 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package logger gives operators per-subsystem, per-file logging: auth
+// events can go to one file, raw user I/O to another for debugging, with
+// independent level thresholds for each. It replaces the scattered
+// log.Fatal/log.Println calls that used to kill the process on a bad
+// config or clutter stderr with everything at once.
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is a logging severity. Levels are ordered; a MethodConfig with
+// Level: warn logs warn and error but not debug or info.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// LevelFromString parses the `level:` value from a Logging config entry.
+func LevelFromString(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// MethodConfig is one entry of the `Logging` config array: a single
+// destination (stderr, a file, or both), the types of message it's
+// interested in, and the minimum level to pass through.
+type MethodConfig struct {
+	Method       string // "stderr", "file", or "stderr+file"
+	Filename     string
+	Level        string
+	Types        []string
+	ExcludeTypes []string
+}
+
+// writer is one configured logging destination with its parsed settings.
+type writer struct {
+	out          io.Writer
+	closer       io.Closer // non-nil only for writers backed by an opened file
+	minLevel     Level
+	types        map[string]bool // nil means "all types"
+	excludeTypes map[string]bool
+}
+
+// Manager fans a single Log call out to every configured writer whose
+// level and type filters accept it.
+type Manager struct {
+	writers []*writer
+}
+
+// NewManager builds a Manager from the parsed `Logging` config array,
+// opening any files it references. Callers should call Close when done
+// to release the file handles.
+func NewManager(configs []MethodConfig) (*Manager, error) {
+	manager := &Manager{}
+
+	for _, config := range configs {
+		minLevel, err := LevelFromString(config.Level)
+		if err != nil {
+			manager.Close()
+			return nil, fmt.Errorf("logging config: %s", err.Error())
+		}
+
+		var out io.Writer
+		var closer io.Closer
+		switch config.Method {
+		case "stderr":
+			out = os.Stderr
+		case "file":
+			f, err := os.OpenFile(config.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				manager.Close()
+				return nil, fmt.Errorf("logging config: could not open %q: %s", config.Filename, err.Error())
+			}
+			out = f
+			closer = f
+		case "stderr+file":
+			f, err := os.OpenFile(config.Filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				manager.Close()
+				return nil, fmt.Errorf("logging config: could not open %q: %s", config.Filename, err.Error())
+			}
+			out = io.MultiWriter(os.Stderr, f)
+			closer = f
+		default:
+			manager.Close()
+			return nil, fmt.Errorf("logging config: unknown method %q", config.Method)
+		}
+
+		manager.writers = append(manager.writers, &writer{
+			out:          out,
+			closer:       closer,
+			minLevel:     minLevel,
+			types:        stringSet(config.Types),
+			excludeTypes: stringSet(config.ExcludeTypes),
+		})
+	}
+
+	return manager, nil
+}
+
+// Close releases every file handle this Manager opened. It's safe to
+// call on a partially-built Manager (e.g. if NewManager is bailing out
+// after a later config entry failed) and is a no-op for stderr-only
+// writers. Callers should Close the outgoing Manager after swapping in
+// a replacement, e.g. on rehash.
+func (manager *Manager) Close() error {
+	var firstErr error
+	for _, w := range manager.writers {
+		if w.closer == nil {
+			continue
+		}
+		if err := w.closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// Log passes messages to every writer whose level and subsystem filters
+// accept them.
+func (manager *Manager) Log(level Level, subsystem string, messages ...string) {
+	line := fmt.Sprintf("[%s] %s", subsystem, strings.Join(messages, " "))
+	for _, w := range manager.writers {
+		if level < w.minLevel {
+			continue
+		}
+		if w.types != nil && !w.types[subsystem] {
+			continue
+		}
+		if w.excludeTypes[subsystem] {
+			continue
+		}
+		fmt.Fprintln(w.out, line)
+	}
+}
+
+// defaultManager is used by the package-level Log function. It's held in
+// an atomic.Value, the same pattern irc.Server uses for its *Config,
+// since SetDefault (called from Rehash) can race with in-flight calls to
+// Log. An empty Value (before the first SetDefault) makes Log fall back
+// to stderr, so early startup code, like initial config parsing, can log
+// before the real logger is configured.
+var defaultManager atomic.Value // stores *Manager
+
+// SetDefault installs manager as the target of package-level Log calls.
+func SetDefault(manager *Manager) {
+	defaultManager.Store(manager)
+}
+
+// Log is a convenience wrapper around the default Manager installed by
+// SetDefault. Until SetDefault is called, it writes straight to stderr.
+func Log(level Level, subsystem string, messages ...string) {
+	manager, _ := defaultManager.Load().(*Manager)
+	if manager == nil {
+		fmt.Fprintf(os.Stderr, "[%s] %s\n", subsystem, strings.Join(messages, " "))
+		return
+	}
+	manager.Log(level, subsystem, messages...)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newTestManager(w *writer) *Manager {
+	return &Manager{writers: []*writer{w}}
+}
+
+func TestLogRespectsMinLevel(t *testing.T) {
+	var buf bytes.Buffer
+	manager := newTestManager(&writer{out: &buf, minLevel: LevelWarn})
+
+	manager.Log(LevelInfo, "server", "should be filtered out")
+	if buf.Len() != 0 {
+		t.Fatalf("expected info below minLevel warn to be filtered, got %q", buf.String())
+	}
+
+	manager.Log(LevelWarn, "server", "should pass")
+	if !strings.Contains(buf.String(), "should pass") {
+		t.Fatalf("expected warn at minLevel to pass, got %q", buf.String())
+	}
+}
+
+func TestLogTypesAllowList(t *testing.T) {
+	var buf bytes.Buffer
+	manager := newTestManager(&writer{out: &buf, types: stringSet([]string{"auth"})})
+
+	manager.Log(LevelInfo, "client", "not in allow-list")
+	if buf.Len() != 0 {
+		t.Fatalf("expected subsystem outside types allow-list to be filtered, got %q", buf.String())
+	}
+
+	manager.Log(LevelInfo, "auth", "in allow-list")
+	if !strings.Contains(buf.String(), "in allow-list") {
+		t.Fatalf("expected subsystem in types allow-list to pass, got %q", buf.String())
+	}
+}
+
+func TestLogExcludeTypesDenyList(t *testing.T) {
+	var buf bytes.Buffer
+	manager := newTestManager(&writer{out: &buf, excludeTypes: stringSet([]string{"raw"})})
+
+	manager.Log(LevelInfo, "raw", "should be excluded")
+	if buf.Len() != 0 {
+		t.Fatalf("expected excluded subsystem to be filtered, got %q", buf.String())
+	}
+
+	manager.Log(LevelInfo, "auth", "should pass")
+	if !strings.Contains(buf.String(), "should pass") {
+		t.Fatalf("expected non-excluded subsystem to pass, got %q", buf.String())
+	}
+}
+
+// TestLogExcludeTypesOverridesTypes confirms excludeTypes wins even when the
+// same subsystem also appears in the types allow-list.
+func TestLogExcludeTypesOverridesTypes(t *testing.T) {
+	var buf bytes.Buffer
+	manager := newTestManager(&writer{
+		out:          &buf,
+		types:        stringSet([]string{"auth"}),
+		excludeTypes: stringSet([]string{"auth"}),
+	})
+
+	manager.Log(LevelInfo, "auth", "should still be excluded")
+	if buf.Len() != 0 {
+		t.Fatalf("expected excludeTypes to override types, got %q", buf.String())
+	}
+}
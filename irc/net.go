@@ -7,6 +7,8 @@ package irc
 import (
 	"net"
 	"strings"
+
+	"github.com/mengzhuo/ergo/irc/cloaks"
 )
 
 func IPString(addr net.Addr) string {
@@ -18,8 +20,18 @@ func IPString(addr net.Addr) string {
 	return ipaddr
 }
 
-func AddrLookupHostname(addr net.Addr) string {
-	return LookupHostname(IPString(addr))
+// AddrLookupHostname returns the hostname to show for addr in WHOIS/JOIN.
+// If cloakConfig is enabled and hasManualVhost is false, this is a cloak
+// derived from addr's CIDR rather than its real PTR record; otherwise it
+// falls back to an ordinary reverse lookup.
+func AddrLookupHostname(addr net.Addr, cloakConfig cloaks.Config, hasManualVhost bool) string {
+	ipStr := IPString(addr)
+	if cloakConfig.Enabled && !hasManualVhost {
+		if ip := net.ParseIP(ipStr); ip != nil {
+			return cloaks.ComputeCloak(ip, cloakConfig)
+		}
+	}
+	return LookupHostname(ipStr)
 }
 
 func LookupHostname(addr string) string {
@@ -0,0 +1,149 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package irc
+
+import (
+	"strings"
+
+	"github.com/mengzhuo/ergo/irc/accounts"
+)
+
+// nickservServiceName is the pseudo-client name clients PRIVMSG to drive
+// account registration, e.g. "/msg NickServ REGISTER hunter2 admin".
+const nickservServiceName = "NickServ"
+
+// nickservCommand is one subcommand of the NickServ service.
+type nickservCommand func(server *Server, client *Client, params []string)
+
+var nickservCommands = map[string]nickservCommand{
+	"REGISTER": nsRegisterHandler,
+	"VERIFY":   nsVerifyHandler,
+	"IDENTIFY": nsIdentifyHandler,
+}
+
+// handleNickServMessage is called from the PRIVMSG path whenever the
+// target casefolds to nickservServiceName.
+func (server *Server) handleNickServMessage(client *Client, text string) {
+	params := strings.Fields(text)
+	if len(params) == 0 {
+		client.Notice("Usage: REGISTER <passphrase> [callback], VERIFY <account> <code>, or IDENTIFY <passphrase>")
+		return
+	}
+
+	command, exists := nickservCommands[strings.ToUpper(params[0])]
+	if !exists {
+		client.Notice("Unknown command. Try REGISTER, VERIFY, or IDENTIFY.")
+		return
+	}
+	command(server, client, params[1:])
+}
+
+func nsRegisterHandler(server *Server, client *Client, params []string) {
+	if len(params) < 1 {
+		client.Notice("Usage: REGISTER <passphrase> [callback]")
+		return
+	}
+
+	config := server.Config().Registration.Accounts
+	if !config.Enabled {
+		client.Notice("Account registration is disabled on this server.")
+		return
+	}
+
+	callback := "none"
+	if len(params) > 1 {
+		callback = params[1]
+	}
+	if !callbackEnabled(config, callback) {
+		client.Notice("That verification method isn't enabled on this server.")
+		return
+	}
+
+	name, err := CasefoldName(client.nick)
+	if err != nil {
+		client.Notice("Could not register: invalid nickname.")
+		return
+	}
+
+	account, err := accounts.Register(server.accountStore(), name, []byte(params[0]), callback)
+	if err != nil {
+		client.Notice("Could not register: " + err.Error())
+		return
+	}
+
+	if client.certfp != "" {
+		// so a client that registers over a cert-authenticated connection
+		// can SASL EXTERNAL with that same cert afterwards
+		if err := accounts.SetCertfp(server.accountStore(), account.Name, client.certfp); err != nil {
+			client.Notice("Account registered, but could not link your certificate: " + err.Error())
+			return
+		}
+	}
+
+	switch callback {
+	case "none":
+		client.Notice("Account registered and verified.")
+	case "admin":
+		client.Notice("Account pending verification. An operator must run /msg NickServ VERIFY " + account.Name + " <code>.")
+	default:
+		client.Notice("Account pending verification; check your email for the confirmation code.")
+	}
+}
+
+func nsVerifyHandler(server *Server, client *Client, params []string) {
+	if len(params) != 2 {
+		client.Notice("Usage: VERIFY <account> <code>")
+		return
+	}
+
+	name, err := CasefoldName(params[0])
+	if err != nil {
+		client.Notice("Could not verify: invalid account name.")
+		return
+	}
+
+	// only the account's own callback type decides whether VERIFY is
+	// oper-only, not whether the admin callback happens to be enabled
+	// elsewhere in config
+	if account, exists := server.accountStore().Get(name); exists && account.Callback == "admin" && !client.flags[Operator] {
+		client.Notice("Only an operator can VERIFY an account pending admin approval.")
+		return
+	}
+
+	if err := accounts.Verify(server.accountStore(), name, params[1]); err != nil {
+		client.Notice("Could not verify: " + err.Error())
+		return
+	}
+	client.Notice("Account " + name + " is now verified.")
+}
+
+func nsIdentifyHandler(server *Server, client *Client, params []string) {
+	if len(params) != 1 {
+		client.Notice("Usage: IDENTIFY <passphrase>")
+		return
+	}
+
+	name, err := CasefoldName(client.nick)
+	if err != nil {
+		client.Notice("Could not identify: invalid nickname.")
+		return
+	}
+
+	account, err := accounts.Identify(server.accountStore(), name, []byte(params[0]))
+	if err != nil {
+		client.Notice("Could not identify: " + err.Error())
+		return
+	}
+	client.account = account.Name
+	client.Notice("You are now identified as " + account.Name + ".")
+}
+
+func callbackEnabled(config AccountRegistrationConfig, callback string) bool {
+	for _, c := range config.EnabledCallbacks {
+		if c == callback {
+			return true
+		}
+	}
+	return false
+}
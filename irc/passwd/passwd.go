@@ -0,0 +1,31 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package passwd wraps bcrypt for hashing and verifying the passwords
+// ergo stores in its YAML config (operator passwords, the server PASS).
+package passwd
+
+import (
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cost is the bcrypt work factor used for all passwords ergo hashes.
+const cost = bcrypt.DefaultCost
+
+// GenerateFromPassword hashes cleartext for storage in the config file.
+// The returned string is safe to paste directly into YAML.
+func GenerateFromPassword(cleartext []byte) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(cleartext, cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CompareHashAndPassword reports whether cleartext matches the given
+// bcrypt hash. It returns false (rather than an error) on any mismatch,
+// including a malformed hash, since callers only ever care pass/fail.
+func CompareHashAndPassword(hash string, cleartext []byte) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), cleartext)
+	return err == nil
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package irc
+
+import (
+	"github.com/DanielOaks/girc-go/ircmsg"
+)
+
+// rehashHandler handles the oper-only REHASH command, re-parsing the
+// server's config file and reporting back anything that couldn't be
+// hot-swapped. This is the same code path triggered by SIGHUP; see
+// Server.Rehash in server.go.
+func rehashHandler(server *Server, client *Client, msg ircmsg.Message) bool {
+	if !client.flags[Operator] {
+		client.Send(nil, server.Config().Server.Name, ERR_NOPRIVILEGES, client.nick, "Permission Denied - You're not an IRC operator")
+		return false
+	}
+
+	notices, err := server.Rehash()
+	if err != nil {
+		client.Notice("Rehash failed: " + err.Error())
+		return false
+	}
+
+	client.Notice("Rehashed " + server.configFilename)
+	for _, notice := range notices {
+		client.Notice(notice)
+	}
+
+	return false
+}
+
+func init() {
+	Commands["REHASH"] = Command{
+		handler:   rehashHandler,
+		oper:      true,
+		minParams: 0,
+	}
+}
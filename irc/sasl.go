@@ -0,0 +1,96 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package irc
+
+import (
+	"encoding/base64"
+
+	"github.com/DanielOaks/girc-go/ircmsg"
+
+	"github.com/mengzhuo/ergo/irc/accounts"
+	"github.com/mengzhuo/ergo/irc/sasl"
+)
+
+// authenticateHandler implements AUTHENTICATE for the SASL mechanisms
+// negotiated via `CAP REQ :sasl`: PLAIN and EXTERNAL (the latter keyed
+// off the client's TLS cert fingerprint rather than a password).
+func authenticateHandler(server *Server, client *Client, msg ircmsg.Message) bool {
+	if len(msg.Params) == 0 {
+		return false
+	}
+
+	switch msg.Params[0] {
+	case "PLAIN":
+		client.saslMechanism = "PLAIN"
+		client.Send(nil, "", "AUTHENTICATE", "+")
+	case "EXTERNAL":
+		client.saslMechanism = "EXTERNAL"
+		client.Send(nil, "", "AUTHENTICATE", "+")
+	default:
+		finishSASL(server, client, msg.Params[0])
+	}
+	return false
+}
+
+func finishSASL(server *Server, client *Client, response string) {
+	fail := func() {
+		client.Send(nil, server.Config().Server.Name, ERR_SASLFAIL, client.nick, "SASL authentication failed")
+		client.saslMechanism = ""
+	}
+
+	switch client.saslMechanism {
+	case "PLAIN":
+		data, err := base64.StdEncoding.DecodeString(response)
+		if err != nil {
+			fail()
+			return
+		}
+		authcid, passphrase, err := sasl.DecodePlain(data)
+		if err != nil {
+			fail()
+			return
+		}
+		name, err := CasefoldName(authcid)
+		if err != nil {
+			fail()
+			return
+		}
+		account, err := accounts.Identify(server.accountStore(), name, passphrase)
+		if err != nil {
+			fail()
+			return
+		}
+		client.account = account.Name
+
+	case "EXTERNAL":
+		account, err := accounts.IdentifyByCertfp(server.accountStore(), client.certfp)
+		if err != nil {
+			fail()
+			return
+		}
+		client.account = account.Name
+
+	default:
+		fail()
+		return
+	}
+
+	client.Send(nil, server.Config().Server.Name, RPL_SASLSUCCESS, client.nick, "SASL authentication successful")
+	client.saslMechanism = ""
+}
+
+func init() {
+	Commands["AUTHENTICATE"] = Command{
+		handler:   authenticateHandler,
+		oper:      false,
+		minParams: 1,
+	}
+}
+
+// requireSASLBeforeRegistration reports whether client should be refused
+// registration (PASS/NICK/USER) for not having completed SASL, per
+// Registration.Accounts.RequireSASL.
+func (server *Server) requireSASLBeforeRegistration(client *Client) bool {
+	return server.Config().Registration.Accounts.RequireSASL && client.account == ""
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package sasl decodes the wire format of the SASL mechanisms ergo
+// supports (PLAIN). EXTERNAL needs no decoding: the identity comes from
+// the client's TLS cert fingerprint, which the caller already has.
+package sasl
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrMalformed is returned when a SASL PLAIN response isn't three
+// NUL-separated fields.
+var ErrMalformed = errors.New("sasl: malformed PLAIN response")
+
+// DecodePlain parses a SASL PLAIN response of the form
+// "authzid\0authcid\0passwd" (RFC 4616) and returns the authentication
+// identity and password. The authorization identity (authzid) is
+// accepted but ignored, matching how /OPER and NickServ IDENTIFY treat
+// the account name as the only identity that matters.
+func DecodePlain(data []byte) (authcid string, password []byte, err error) {
+	parts := bytes.SplitN(data, []byte{0}, 3)
+	if len(parts) != 3 {
+		return "", nil, ErrMalformed
+	}
+	return string(parts[1]), parts[2], nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package sasl
+
+import "testing"
+
+func TestDecodePlain(t *testing.T) {
+	data := []byte("\x00shivaram\x00hunter2")
+	authcid, password, err := DecodePlain(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if authcid != "shivaram" {
+		t.Fatalf("expected authcid %q, got %q", "shivaram", authcid)
+	}
+	if string(password) != "hunter2" {
+		t.Fatalf("expected password %q, got %q", "hunter2", password)
+	}
+}
+
+func TestDecodePlainMalformed(t *testing.T) {
+	if _, _, err := DecodePlain([]byte("no nuls here")); err != ErrMalformed {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package irc
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/mengzhuo/ergo/irc/accounts"
+	"github.com/mengzhuo/ergo/irc/cloaks"
+	"github.com/mengzhuo/ergo/irc/connection_limits"
+	"github.com/mengzhuo/ergo/irc/logger"
+	"github.com/mengzhuo/ergo/irc/utils/proxyproto"
+)
+
+// parseDuration parses a config duration string, logging and falling back
+// to zero (meaning "no limit") if it's empty or malformed.
+func parseDuration(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		log.Println("invalid duration in config:", s, err.Error())
+		return 0
+	}
+	return d
+}
+
+// Server holds the state for a running ergo server instance: its active
+// config, connection limiter and throttler, log manager and account store.
+// This file only concerns itself with startup/shutdown and config reload.
+type Server struct {
+	configFilename string
+	currentConfig  atomic.Value // stores *Config
+
+	rehashMutex sync.Mutex // serializes concurrent rehashes
+
+	connectionLimiter   atomic.Pointer[connection_limits.Limiter]
+	connectionThrottler atomic.Pointer[connection_limits.Throttler]
+
+	logManager *logger.Manager
+
+	accounts accounts.Store
+}
+
+// accountStore returns the store backing NickServ registration/SASL.
+func (server *Server) accountStore() accounts.Store {
+	return server.accounts
+}
+
+// addrLookupHostname is the server-aware wrapper around AddrLookupHostname,
+// using the currently active IPCloaking config.
+func (server *Server) addrLookupHostname(addr net.Addr, hasManualVhost bool) string {
+	config := server.Config().Server.IPCloaking
+	return AddrLookupHostname(addr, cloaks.Config{
+		Enabled:     config.Enabled,
+		Netname:     config.Netname,
+		CidrLenIPv4: config.CidrLenIPv4,
+		CidrLenIPv6: config.CidrLenIPv6,
+		NumBits:     config.NumBits,
+		Secret:      config.Secret,
+	}, hasManualVhost)
+}
+
+// wrapIfProxied checks conn's peer address against Server.ProxyAllowedFrom
+// and, if it matches, parses a PROXY protocol header off the front of the
+// connection and returns a net.Conn whose RemoteAddr() is the real client
+// address. This must run before IPString/AddrLookupHostname do, so bans
+// and cloaks see the real client rather than the proxy. A non-matching
+// peer, or a listener with nothing configured, gets conn back unchanged.
+func (server *Server) wrapIfProxied(conn net.Conn) (net.Conn, error) {
+	remoteIP := net.ParseIP(IPString(conn.RemoteAddr()))
+	if remoteIP == nil || !ipInAllowedList(remoteIP, server.Config().Server.ProxyAllowedFrom) {
+		return conn, nil
+	}
+	return proxyproto.ReadHeader(conn)
+}
+
+func ipInAllowedList(ip net.IP, cidrs []string) bool {
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			// allow plain IPs alongside CIDRs in the allow-list
+			if ip.Equal(net.ParseIP(cidr)) {
+				return true
+			}
+			continue
+		}
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConnectionLimits is called by the accept loop immediately after
+// accept(2) returns and before NewClient runs. It rejects the connection
+// if ip's CIDR is over its concurrent-connection limit or is currently
+// throttle-banned for reconnecting too fast.
+func (server *Server) checkConnectionLimits(ip net.IP) error {
+	if throttler := server.connectionThrottler.Load(); throttler != nil {
+		if err := throttler.AddClientNow(ip); err != nil {
+			return err
+		}
+	}
+	if limiter := server.connectionLimiter.Load(); limiter != nil {
+		if err := limiter.AddClient(ip); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewServer creates a Server around an already-loaded Config. It returns
+// an error, rather than killing the process, if any part of config is
+// invalid — the same contract Rehash() has for a config reload.
+func NewServer(configFilename string, config *Config) (*Server, error) {
+	server := &Server{
+		configFilename: configFilename,
+	}
+	server.currentConfig.Store(config)
+
+	logManager, err := buildLogManager(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logging config: %s", err.Error())
+	}
+	logger.SetDefault(logManager)
+	server.logManager = logManager
+
+	limiter, err := buildConnectionLimiter(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection-limits config: %s", err.Error())
+	}
+	server.connectionLimiter.Store(limiter)
+
+	throttler, err := buildConnectionThrottler(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection-throttle config: %s", err.Error())
+	}
+	server.connectionThrottler.Store(throttler)
+
+	server.accounts = newFileAccountStore(config.Datastore.Path)
+
+	return server, nil
+}
+
+func buildLogManager(config *Config) (*logger.Manager, error) {
+	methods := make([]logger.MethodConfig, len(config.Logging))
+	for i, entry := range config.Logging {
+		methods[i] = logger.MethodConfig{
+			Method:       entry.Method,
+			Filename:     entry.Filename,
+			Level:        entry.Level,
+			Types:        entry.Types,
+			ExcludeTypes: entry.ExcludeTypes,
+		}
+	}
+	return logger.NewManager(methods)
+}
+
+func buildConnectionLimiter(config *Config) (*connection_limits.Limiter, error) {
+	return connection_limits.NewLimiter(connection_limits.LimiterConfig{
+		Enabled:            config.Server.ConnectionLimits.Enabled,
+		CidrLenIPv4:        config.Server.ConnectionLimits.CidrLenIPv4,
+		CidrLenIPv6:        config.Server.ConnectionLimits.CidrLenIPv6,
+		ConnectionsPerCidr: config.Server.ConnectionLimits.ConnectionsPerCidr,
+		ExemptedCIDRs:      config.Server.ConnectionLimits.ExemptedCIDRs,
+	})
+}
+
+// throttlerExemptedCIDRs is the CIDR list passed to the throttler: whatever
+// the operator configured under connection-throttle.exempted-cidrs, plus
+// ProxyAllowedFrom automatically, so a trusted reverse proxy's single
+// source address is never itself throttle-banned.
+func throttlerExemptedCIDRs(config *Config) []string {
+	cidrs := append([]string{}, config.Server.ConnectionThrottle.ExemptedCIDRs...)
+	for _, entry := range config.Server.ProxyAllowedFrom {
+		// plain IPs are allowed in ProxyAllowedFrom (see ipInAllowedList),
+		// so turn them into single-address CIDRs for the throttler
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			entry = (&net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}).String()
+		}
+		cidrs = append(cidrs, entry)
+	}
+	return cidrs
+}
+
+func buildConnectionThrottler(config *Config) (*connection_limits.Throttler, error) {
+	return connection_limits.NewThrottler(connection_limits.ThrottlerConfig{
+		Enabled:        config.Server.ConnectionThrottle.Enabled,
+		CidrLenIPv4:    config.Server.ConnectionThrottle.CidrLenIPv4,
+		CidrLenIPv6:    config.Server.ConnectionThrottle.CidrLenIPv6,
+		Duration:       parseDuration(config.Server.ConnectionThrottle.Duration),
+		MaxConnections: config.Server.ConnectionThrottle.MaxConnections,
+		BanDuration:    parseDuration(config.Server.ConnectionThrottle.BanDuration),
+		BanMessage:     config.Server.ConnectionThrottle.BanMessage,
+		ExemptedCIDRs:  throttlerExemptedCIDRs(config),
+	})
+}
+
+// Run starts the server's signal handlers and blocks forever. Listener
+// setup and the client accept loop live elsewhere in the package.
+func (server *Server) Run() {
+	server.listenForRehashSignal()
+	select {}
+}
+
+// Config returns the currently active configuration. It's safe to call
+// from any goroutine; hot paths should prefer this over holding onto a
+// *Config for longer than a single operation, since a rehash can replace
+// it at any time.
+func (server *Server) Config() *Config {
+	return server.currentConfig.Load().(*Config)
+}
+
+// listenForRehashSignal rehashes the server whenever SIGHUP is received.
+func (server *Server) listenForRehashSignal() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		for range sigChan {
+			log.Println("Rehashing due to SIGHUP")
+			if _, err := server.Rehash(); err != nil {
+				log.Println("Rehash failed:", err.Error())
+			}
+		}
+	}()
+}
+
+// Rehash re-reads the server's config file from disk, validates it, and
+// atomically swaps it in for the config currently in use. Hot paths that
+// call server.Config() pick up the new values on their very next call;
+// nothing currently connected is dropped.
+//
+// It returns a list of human-readable notices describing settings that
+// changed but couldn't be hot-swapped (for example listener bind
+// addresses), for the caller to relay back to the invoking oper. If the
+// new config fails to load or fails validation, the running config is
+// left untouched and an error is returned.
+func (server *Server) Rehash() (notices []string, err error) {
+	server.rehashMutex.Lock()
+	defer server.rehashMutex.Unlock()
+
+	newConfig, err := LoadConfig(server.configFilename)
+	if err != nil {
+		return nil, fmt.Errorf("rehash: %s", err.Error())
+	}
+
+	newLimiter, err := buildConnectionLimiter(newConfig)
+	if err != nil {
+		return nil, fmt.Errorf("rehash: %s", err.Error())
+	}
+
+	newLogManager, err := buildLogManager(newConfig)
+	if err != nil {
+		return nil, fmt.Errorf("rehash: %s", err.Error())
+	}
+
+	newThrottler, err := buildConnectionThrottler(newConfig)
+	if err != nil {
+		return nil, fmt.Errorf("rehash: %s", err.Error())
+	}
+
+	oldConfig := server.Config()
+	notices = unswappableChanges(oldConfig, newConfig)
+
+	oldLogManager := server.logManager
+
+	server.currentConfig.Store(newConfig)
+	server.connectionLimiter.Store(newLimiter)
+	server.connectionThrottler.Store(newThrottler)
+	logger.SetDefault(newLogManager)
+	server.logManager = newLogManager
+
+	if oldLogManager != nil {
+		if err := oldLogManager.Close(); err != nil {
+			log.Println("error closing previous log files after rehash:", err.Error())
+		}
+	}
+
+	return notices, nil
+}
+
+// unswappableChanges reports config fields that differ between old and new
+// but can't be applied to a server that's already running.
+func unswappableChanges(old, new *Config) (notices []string) {
+	if !stringSlicesEqual(old.Server.Listen, new.Server.Listen) {
+		notices = append(notices, "Server.Listen changed; restart ergo to bind the new addresses")
+	}
+	if old.Server.Wslisten != new.Server.Wslisten {
+		notices = append(notices, "Server.ws-listen changed; restart ergo to bind the new address")
+	}
+	if old.Datastore.Path != new.Datastore.Path {
+		notices = append(notices, "Datastore.Path changed; restart ergo to use the new datastore")
+	}
+	return notices
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+// Package proxyproto parses a HAProxy PROXY protocol v1 or v2 header off
+// the front of an accepted connection, so ergo can sit behind
+// stunnel/HAProxy/nginx-stream without losing real client IPs for bans
+// and cloaks. Only callers that've already checked the peer address
+// against Server.ProxyAllowedFrom should call ReadHeader.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrBadHeader is returned when the PROXY header is malformed or isn't a
+// PROXY header at all.
+var ErrBadHeader = errors.New("proxyproto: malformed PROXY header")
+
+var v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// Conn wraps a net.Conn, serving reads through a buffer that may already
+// hold bytes read past the PROXY header, and reports RemoteAddr() as the
+// real client address carried in that header rather than the address of
+// the proxy that's actually connected to us.
+type Conn struct {
+	net.Conn
+	reader     *bufio.Reader
+	remoteAddr net.Addr
+}
+
+func (c *Conn) Read(b []byte) (int, error) { return c.reader.Read(b) }
+
+// RemoteAddr returns the real client address from the PROXY header.
+func (c *Conn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+// ReadHeader reads a PROXY v1 or v2 header off the front of conn (which
+// may be a plaintext or not-yet-handshaken TLS connection; v2 headers
+// arrive before the TLS ClientHello) and returns a Conn whose
+// RemoteAddr() is the real client address. It returns ErrBadHeader if
+// the header is malformed.
+func ReadHeader(conn net.Conn) (*Conn, error) {
+	reader := bufio.NewReader(conn)
+
+	sig, err := reader.Peek(len(v2Signature))
+	if err == nil && bytes.Equal(sig, v2Signature) {
+		return readV2(conn, reader)
+	}
+
+	return readV1(conn, reader)
+}
+
+func readV1(conn net.Conn, reader *bufio.Reader) (*Conn, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, ErrBadHeader
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.Split(line, " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, ErrBadHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return &Conn{Conn: conn, reader: reader, remoteAddr: conn.RemoteAddr()}, nil
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, ErrBadHeader
+		}
+		srcIP := net.ParseIP(fields[2])
+		if srcIP == nil {
+			return nil, ErrBadHeader
+		}
+		srcPort, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, ErrBadHeader
+		}
+		addr := &net.TCPAddr{IP: srcIP, Port: srcPort}
+		return &Conn{Conn: conn, reader: reader, remoteAddr: addr}, nil
+	default:
+		return nil, ErrBadHeader
+	}
+}
+
+const (
+	v2CmdLocal = 0x0
+	v2CmdProxy = 0x1
+
+	v2FamInet  = 0x1
+	v2FamInet6 = 0x2
+)
+
+func readV2(conn net.Conn, reader *bufio.Reader) (*Conn, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, ErrBadHeader
+	}
+
+	verCmd := header[12]
+	if verCmd>>4 != 2 {
+		return nil, ErrBadHeader
+	}
+	cmd := verCmd & 0x0F
+
+	famProto := header[13]
+	fam := famProto >> 4
+
+	length := binary.BigEndian.Uint16(header[14:16])
+	addrBlock := make([]byte, length)
+	if _, err := io.ReadFull(reader, addrBlock); err != nil {
+		return nil, ErrBadHeader
+	}
+
+	if cmd == v2CmdLocal {
+		// health check / keepalive from the proxy itself; no real client
+		return &Conn{Conn: conn, reader: reader, remoteAddr: conn.RemoteAddr()}, nil
+	}
+	if cmd != v2CmdProxy {
+		return nil, ErrBadHeader
+	}
+
+	switch fam {
+	case v2FamInet:
+		if len(addrBlock) < 12 {
+			return nil, ErrBadHeader
+		}
+		srcIP := net.IP(addrBlock[0:4])
+		srcPort := binary.BigEndian.Uint16(addrBlock[8:10])
+		addr := &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+		return &Conn{Conn: conn, reader: reader, remoteAddr: addr}, nil
+	case v2FamInet6:
+		if len(addrBlock) < 36 {
+			return nil, ErrBadHeader
+		}
+		srcIP := net.IP(addrBlock[0:16])
+		srcPort := binary.BigEndian.Uint16(addrBlock[32:34])
+		addr := &net.TCPAddr{IP: srcIP, Port: int(srcPort)}
+		return &Conn{Conn: conn, reader: reader, remoteAddr: addr}, nil
+	default:
+		return nil, fmt.Errorf("proxyproto: unsupported address family %d", fam)
+	}
+}
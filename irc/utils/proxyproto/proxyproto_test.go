@@ -0,0 +1,97 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+// fakeConn lets us feed arbitrary bytes through ReadHeader without a real
+// socket; RemoteAddr is the proxy's own address, which is what a real
+// listener would hand us before the PROXY header is parsed.
+type fakeConn struct {
+	net.Conn
+	r *bytes.Reader
+}
+
+func (f *fakeConn) Read(b []byte) (int, error) { return f.r.Read(b) }
+func (f *fakeConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 12345}
+}
+
+func TestReadHeaderV1(t *testing.T) {
+	data := "PROXY TCP4 203.0.113.5 203.0.113.6 56324 6667\r\nhello"
+	conn, err := ReadHeader(&fakeConn{r: bytes.NewReader([]byte(data))})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.Equal(net.ParseIP("203.0.113.5")) || tcpAddr.Port != 56324 {
+		t.Fatalf("unexpected remote addr: %v", conn.RemoteAddr())
+	}
+
+	rest := make([]byte, 5)
+	if _, err := conn.Read(rest); err != nil {
+		t.Fatalf("unexpected error reading remainder: %s", err.Error())
+	}
+	if string(rest) != "hello" {
+		t.Fatalf("expected remaining bytes to be preserved, got %q", rest)
+	}
+}
+
+func TestReadHeaderV1Malformed(t *testing.T) {
+	data := "PROXY GARBAGE\r\n"
+	_, err := ReadHeader(&fakeConn{r: bytes.NewReader([]byte(data))})
+	if err != ErrBadHeader {
+		t.Fatalf("expected ErrBadHeader, got %v", err)
+	}
+}
+
+func buildV2Header(ip net.IP, port uint16) []byte {
+	var header []byte
+	header = append(header, v2Signature...)
+	header = append(header, 0x21) // version 2, command PROXY
+	header = append(header, 0x11) // family INET, proto STREAM
+
+	ip4 := ip.To4()
+	addrBlock := make([]byte, 12)
+	copy(addrBlock[0:4], ip4)
+	copy(addrBlock[4:8], ip4) // dst addr, unused by us
+	binary.BigEndian.PutUint16(addrBlock[8:10], port)
+	binary.BigEndian.PutUint16(addrBlock[10:12], 6667)
+
+	lenBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenBytes, uint16(len(addrBlock)))
+	header = append(header, lenBytes...)
+	header = append(header, addrBlock...)
+	return header
+}
+
+func TestReadHeaderV2(t *testing.T) {
+	ip := net.ParseIP("198.51.100.7")
+	header := buildV2Header(ip, 51234)
+	data := append(header, []byte("payload")...)
+
+	conn, err := ReadHeader(&fakeConn{r: bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !tcpAddr.IP.Equal(ip) || tcpAddr.Port != 51234 {
+		t.Fatalf("unexpected remote addr: %v", conn.RemoteAddr())
+	}
+
+	rest := make([]byte, len("payload"))
+	if _, err := conn.Read(rest); err != nil {
+		t.Fatalf("unexpected error reading remainder: %s", err.Error())
+	}
+	if string(rest) != "payload" {
+		t.Fatalf("expected remaining bytes to be preserved, got %q", rest)
+	}
+}
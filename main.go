@@ -0,0 +1,84 @@
+// Copyright (c) 2016- Daniel Oaks <daniel@danieloaks.net>
+// released under the MIT license
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"github.com/mengzhuo/ergo/irc"
+	"github.com/mengzhuo/ergo/irc/passwd"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "genpasswd":
+		genPasswd()
+	case "run":
+		run()
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ergo run <config.yaml>")
+	fmt.Fprintln(os.Stderr, "       ergo genpasswd")
+}
+
+// genPasswd reads a cleartext password from stdin and prints the bcrypt
+// hash to paste into the config file, so plaintext passwords never have
+// to touch disk.
+func genPasswd() {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(os.Stderr, "error reading password:", err.Error())
+		os.Exit(1)
+	}
+	cleartext := []byte(trimNewline(line))
+
+	hash, err := passwd.GenerateFromPassword(cleartext)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error hashing password:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println(hash)
+}
+
+func trimNewline(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func run() {
+	if len(os.Args) < 3 {
+		usage()
+		os.Exit(1)
+	}
+	configFilename := os.Args[2]
+
+	config, err := irc.LoadConfig(configFilename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not load config:", err.Error())
+		os.Exit(1)
+	}
+
+	server, err := irc.NewServer(configFilename, config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not start server:", err.Error())
+		os.Exit(1)
+	}
+	server.Run()
+}